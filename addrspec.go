@@ -0,0 +1,38 @@
+package socks5
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// AddrSpec is used to return the target AddrSpec, which may be resolved
+// or unresolved (in which case FQDN is set).
+type AddrSpec struct {
+	FQDN string
+	IP   net.IP
+	Port int
+}
+
+func (a AddrSpec) String() string {
+	if a.FQDN != "" {
+		return fmt.Sprintf("%s (%s):%d", a.FQDN, a.IP, a.Port)
+	}
+	return fmt.Sprintf("%s:%d", a.IP, a.Port)
+}
+
+// Address returns a string suitable to dial; prefers the IP over the
+// FQDN.
+func (a AddrSpec) Address() string {
+	if len(a.IP) != 0 {
+		return net.JoinHostPort(a.IP.String(), strconv.Itoa(a.Port))
+	}
+	return net.JoinHostPort(a.FQDN, strconv.Itoa(a.Port))
+}
+
+// AddressRewriter can be used to transparently rewrite addresses. This
+// is invoked before the RuleSet is invoked.
+type AddressRewriter interface {
+	Rewrite(ctx context.Context, request *Request) (context.Context, *AddrSpec)
+}
@@ -0,0 +1,126 @@
+package socks5
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// NoAuth is the "no authentication required" method code.
+	NoAuth = uint8(0)
+	// UserPassAuth is the username/password method code (RFC 1929).
+	UserPassAuth = uint8(2)
+
+	noAcceptableAuth = uint8(255)
+	userAuthVersion  = uint8(1)
+	authSuccess      = uint8(0)
+	authFailure      = uint8(1)
+)
+
+var errUserAuthFailed = errors.New("user authentication failed")
+var errNoSupportedAuth = errors.New("no supported authentication mechanism")
+
+// AuthContext carries the method and any negotiated payload (e.g. the
+// authenticated username) from Authenticate through to Request.
+type AuthContext struct {
+	Method  uint8
+	Payload map[string]string
+}
+
+// Authenticator is used to implement authentication for SOCKS5
+type Authenticator interface {
+	Authenticate(reader io.Reader, writer io.Writer) (*AuthContext, error)
+	GetCode() uint8
+}
+
+// NoAuthAuthenticator is used to handle the "no authentication" mode
+type NoAuthAuthenticator struct{}
+
+func (a NoAuthAuthenticator) GetCode() uint8 {
+	return NoAuth
+}
+
+func (a NoAuthAuthenticator) Authenticate(reader io.Reader, writer io.Writer) (*AuthContext, error) {
+	if _, err := writer.Write([]byte{socks5Version, NoAuth}); err != nil {
+		return nil, err
+	}
+	return &AuthContext{NoAuth, nil}, nil
+}
+
+// UserPassAuthenticator is used to handle username/password based
+// authentication (RFC 1929)
+type UserPassAuthenticator struct {
+	Credentials CredentialStore
+}
+
+func (a UserPassAuthenticator) GetCode() uint8 {
+	return UserPassAuth
+}
+
+func (a UserPassAuthenticator) Authenticate(reader io.Reader, writer io.Writer) (*AuthContext, error) {
+	if _, err := writer.Write([]byte{socks5Version, UserPassAuth}); err != nil {
+		return nil, err
+	}
+
+	header := []byte{0, 0}
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	if header[0] != userAuthVersion {
+		return nil, fmt.Errorf("unsupported user/pass auth version: %v", header[0])
+	}
+
+	user := make([]byte, header[1])
+	if _, err := io.ReadFull(reader, user); err != nil {
+		return nil, err
+	}
+
+	passLen := []byte{0}
+	if _, err := io.ReadFull(reader, passLen); err != nil {
+		return nil, err
+	}
+	pass := make([]byte, passLen[0])
+	if _, err := io.ReadFull(reader, pass); err != nil {
+		return nil, err
+	}
+
+	if !a.Credentials.Valid(string(user), string(pass)) {
+		if _, err := writer.Write([]byte{userAuthVersion, authFailure}); err != nil {
+			return nil, err
+		}
+		return nil, errUserAuthFailed
+	}
+
+	if _, err := writer.Write([]byte{userAuthVersion, authSuccess}); err != nil {
+		return nil, err
+	}
+
+	return &AuthContext{UserPassAuth, map[string]string{"Username": string(user)}}, nil
+}
+
+// authenticate negotiates the auth method with the client and runs it.
+func (s *Server) authenticate(conn io.Writer, bufConn io.Reader) (*AuthContext, error) {
+	header := []byte{0}
+	if _, err := io.ReadFull(bufConn, header); err != nil {
+		return nil, err
+	}
+
+	methods := make([]byte, header[0])
+	if _, err := io.ReadFull(bufConn, methods); err != nil {
+		return nil, err
+	}
+
+	if s.config.AuthMethodsSort != nil {
+		methods = s.config.AuthMethodsSort(methods)
+	}
+
+	for _, method := range methods {
+		if cator, ok := s.authMethods[method]; ok {
+			return cator.Authenticate(bufConn, conn)
+		}
+	}
+
+	conn.Write([]byte{socks5Version, noAcceptableAuth})
+	return nil, errNoSupportedAuth
+}
@@ -0,0 +1,159 @@
+package socks5
+
+import (
+	"fmt"
+	"io"
+	"net"
+)
+
+// SOCKS5 address types, shared by the server's request parser and the
+// client Dialer.
+const (
+	ipv4Address = uint8(1)
+	fqdnAddress = uint8(3)
+	ipv6Address = uint8(4)
+
+	socks5CmdConnect   = uint8(1)
+	socks5CmdBind      = uint8(2)
+	socks5CmdAssociate = uint8(3)
+)
+
+// writeAddrSpec encodes addr using the SOCKS5 address wire format (ATYP,
+// address, port), as used by both CONNECT requests and replies.
+func writeAddrSpec(w io.Writer, addr *AddrSpec) error {
+	var buf []byte
+	switch {
+	case addr == nil:
+		buf = []byte{ipv4Address, 0, 0, 0, 0}
+	case addr.FQDN != "":
+		buf = append([]byte{fqdnAddress, byte(len(addr.FQDN))}, addr.FQDN...)
+	case addr.IP.To4() != nil:
+		buf = append([]byte{ipv4Address}, addr.IP.To4()...)
+	case addr.IP.To16() != nil:
+		buf = append([]byte{ipv6Address}, addr.IP.To16()...)
+	default:
+		return fmt.Errorf("unsupported address for %v", addr)
+	}
+
+	port := 0
+	if addr != nil {
+		port = addr.Port
+	}
+	buf = append(buf, byte(port>>8), byte(port))
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// readAddrSpec decodes a SOCKS5 address (ATYP, address, port) from r.
+func readAddrSpec(r io.Reader) (*AddrSpec, error) {
+	atyp := []byte{0}
+	if _, err := io.ReadFull(r, atyp); err != nil {
+		return nil, fmt.Errorf("read address type: %w", err)
+	}
+
+	addr := &AddrSpec{}
+	switch atyp[0] {
+	case ipv4Address:
+		ip := make([]byte, 4)
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return nil, fmt.Errorf("read ipv4: %w", err)
+		}
+		addr.IP = net.IP(ip)
+	case ipv6Address:
+		ip := make([]byte, 16)
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return nil, fmt.Errorf("read ipv6: %w", err)
+		}
+		addr.IP = net.IP(ip)
+	case fqdnAddress:
+		length := []byte{0}
+		if _, err := io.ReadFull(r, length); err != nil {
+			return nil, fmt.Errorf("read fqdn length: %w", err)
+		}
+		fqdn := make([]byte, length[0])
+		if _, err := io.ReadFull(r, fqdn); err != nil {
+			return nil, fmt.Errorf("read fqdn: %w", err)
+		}
+		addr.FQDN = string(fqdn)
+	default:
+		return nil, unrecognizedAddrType
+	}
+
+	port := []byte{0, 0}
+	if _, err := io.ReadFull(r, port); err != nil {
+		return nil, fmt.Errorf("read port: %w", err)
+	}
+	addr.Port = int(port[0])<<8 | int(port[1])
+
+	return addr, nil
+}
+
+// negotiateClientAuth runs the client side of RFC 1928 method
+// negotiation: advertise methods, then authenticate with whichever one
+// the proxy selects. Shared by Dialer and Redispatch.
+func negotiateClientAuth(conn net.Conn, methods []ClientAuthenticator) error {
+	hello := make([]byte, 0, 2+len(methods))
+	hello = append(hello, socks5Version, byte(len(methods)))
+	for _, m := range methods {
+		hello = append(hello, m.Method())
+	}
+	if _, err := conn.Write(hello); err != nil {
+		return fmt.Errorf("send auth methods: %w", err)
+	}
+
+	selected := []byte{0, 0}
+	if _, err := io.ReadFull(conn, selected); err != nil {
+		return fmt.Errorf("read selected auth method: %w", err)
+	}
+	if selected[0] != socks5Version {
+		return fmt.Errorf("unexpected proxy version: %d", selected[0])
+	}
+
+	var chosen ClientAuthenticator
+	for _, m := range methods {
+		if m.Method() == selected[1] {
+			chosen = m
+			break
+		}
+	}
+	if chosen == nil {
+		return fmt.Errorf("proxy selected unsupported auth method: %d", selected[1])
+	}
+
+	if err := chosen.Authenticate(conn); err != nil {
+		return fmt.Errorf("authenticate: %w", err)
+	}
+
+	return nil
+}
+
+// sendClientCommand issues a SOCKS5 request (CONNECT, BIND or UDP
+// ASSOCIATE) for dest and reads back the reply, returning the address
+// the proxy bound. Shared by Dialer and Redispatch.
+func sendClientCommand(conn net.Conn, cmd uint8, dest *AddrSpec) (*AddrSpec, error) {
+	if _, err := conn.Write([]byte{socks5Version, cmd, 0}); err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	if err := writeAddrSpec(conn, dest); err != nil {
+		return nil, fmt.Errorf("send destination address: %w", err)
+	}
+
+	reply := []byte{0, 0, 0}
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, fmt.Errorf("read reply: %w", err)
+	}
+	if reply[0] != socks5Version {
+		return nil, fmt.Errorf("unexpected proxy version in reply: %d", reply[0])
+	}
+	if reply[1] != 0 {
+		return nil, fmt.Errorf("proxy refused request: reply code %d", reply[1])
+	}
+
+	bound, err := readAddrSpec(conn)
+	if err != nil {
+		return nil, fmt.Errorf("read bound address: %w", err)
+	}
+
+	return bound, nil
+}
@@ -0,0 +1,197 @@
+package socks5
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Client-side authentication method codes, mirrored from the RFC 1928
+// method negotiation used on the server side.
+const (
+	clientAuthNoAuth   = uint8(0)
+	clientAuthUserPass = uint8(2)
+)
+
+// ClientAuthenticator negotiates a single client-side authentication
+// method with a remote SOCKS5 proxy during Dialer's handshake.
+type ClientAuthenticator interface {
+	// Method returns the method byte to advertise during negotiation.
+	Method() uint8
+
+	// Authenticate performs the method-specific negotiation once the
+	// proxy has selected this method.
+	Authenticate(conn net.Conn) error
+}
+
+type noAuthClientAuthenticator struct{}
+
+func (noAuthClientAuthenticator) Method() uint8 { return clientAuthNoAuth }
+
+func (noAuthClientAuthenticator) Authenticate(conn net.Conn) error { return nil }
+
+// NoAuthClientAuthenticator performs no authentication negotiation, for
+// use against proxies running NoAuthAuthenticator.
+var NoAuthClientAuthenticator ClientAuthenticator = noAuthClientAuthenticator{}
+
+// UserPassClientAuthenticator implements the client side of RFC 1929
+// username/password authentication.
+type UserPassClientAuthenticator struct {
+	Username string
+	Password string
+}
+
+func (a *UserPassClientAuthenticator) Method() uint8 { return clientAuthUserPass }
+
+func (a *UserPassClientAuthenticator) Authenticate(conn net.Conn) error {
+	req := make([]byte, 0, 3+len(a.Username)+len(a.Password))
+	req = append(req, 1, byte(len(a.Username)))
+	req = append(req, a.Username...)
+	req = append(req, byte(len(a.Password)))
+	req = append(req, a.Password...)
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("send user/pass: %w", err)
+	}
+
+	reply := []byte{0, 0}
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("read user/pass reply: %w", err)
+	}
+	if reply[1] != 0 {
+		return fmt.Errorf("user/pass authentication rejected: code %d", reply[1])
+	}
+	return nil
+}
+
+// GSSAPIClientAuthenticator is an extension point for RFC 1961 GSSAPI
+// authentication. This package does not implement GSSAPI itself; plug in
+// a real implementation (e.g. backed by gokrb5) by satisfying this
+// interface and passing it in Dialer.AuthMethods.
+type GSSAPIClientAuthenticator interface {
+	ClientAuthenticator
+}
+
+// aLongTimeAgo is set as a connection deadline to force in-flight reads
+// and writes to fail immediately, used to honor context cancellation
+// during the proxy handshake.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// Dialer makes outbound connections through a remote SOCKS5 proxy,
+// sharing the wire codec used by Server so this package alone is enough
+// to write SOCKS5-chaining proxies.
+type Dialer struct {
+	// ProxyNetwork and ProxyAddress identify the upstream proxy, e.g.
+	// "tcp" and "proxy.example.com:1080".
+	ProxyNetwork string
+	ProxyAddress string
+
+	// AuthMethods lists the client authenticators to offer, in order.
+	// Defaults to NoAuthClientAuthenticator if empty.
+	AuthMethods []ClientAuthenticator
+
+	// ProxyDial is used to establish the connection to the proxy itself.
+	// Defaults to a net.Dialer.
+	ProxyDial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// NewDialer returns a Dialer usable as a golang.org/x/net/proxy.Dialer
+// (it implements Dial(network, addr string) (net.Conn, error)) for the
+// upstream proxy at proxyAddress.
+func NewDialer(proxyAddress string, auth ...ClientAuthenticator) *Dialer {
+	return &Dialer{
+		ProxyNetwork: "tcp",
+		ProxyAddress: proxyAddress,
+		AuthMethods:  auth,
+	}
+}
+
+// Dial connects to addr via the proxy. It satisfies proxy.Dialer.
+func (d *Dialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to addr via the proxy, honoring ctx's deadline
+// and cancellation for the duration of the dial and handshake.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dial := d.ProxyDial
+	if dial == nil {
+		var netDialer net.Dialer
+		dial = netDialer.DialContext
+	}
+
+	proxyNetwork := d.ProxyNetwork
+	if proxyNetwork == "" {
+		proxyNetwork = "tcp"
+	}
+
+	conn, err := dial(ctx, proxyNetwork, d.ProxyAddress)
+	if err != nil {
+		return nil, fmt.Errorf("dial proxy %s: %w", d.ProxyAddress, err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(aLongTimeAgo)
+		case <-done:
+		}
+	}()
+
+	if err := d.handshake(conn, addr); err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (d *Dialer) handshake(conn net.Conn, addr string) error {
+	methods := d.AuthMethods
+	if len(methods) == 0 {
+		methods = []ClientAuthenticator{NoAuthClientAuthenticator}
+	}
+
+	if err := negotiateClientAuth(conn, methods); err != nil {
+		return err
+	}
+
+	dest, err := parseDialAddr(addr)
+	if err != nil {
+		return err
+	}
+
+	_, err = sendClientCommand(conn, socks5CmdConnect, dest)
+	return err
+}
+
+func parseDialAddr(addr string) (*AddrSpec, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("parse address %q: %w", addr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("parse port %q: %w", portStr, err)
+	}
+
+	dest := &AddrSpec{Port: port}
+	if ip := net.ParseIP(host); ip != nil {
+		dest.IP = ip
+	} else {
+		dest.FQDN = host
+	}
+	return dest, nil
+}
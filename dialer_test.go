@@ -0,0 +1,78 @@
+package socks5
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestDialerAgainstServer exercises the full client/server round trip:
+// a Dialer negotiates with a local Server and CONNECTs to an echo
+// listener through it.
+func TestDialerAgainstServer(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen echo: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go echoConn(conn)
+		}
+	}()
+
+	srv, err := New(&Config{Rules: PermitAll()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen proxy: %v", err)
+	}
+	defer proxyListener.Close()
+	go srv.Serve(proxyListener)
+
+	dialer := NewDialer(proxyListener.Addr().String())
+	conn, err := dialer.Dial("tcp", echo.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	want := []byte("hello through the proxy")
+	if _, err := conn.Write(want); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	got := make([]byte, len(want))
+	if _, err := conn.Read(got); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("echo = %q, want %q", got, want)
+	}
+}
+
+func echoConn(conn net.Conn) {
+	defer conn.Close()
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			if _, werr := conn.Write(buf[:n]); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
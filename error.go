@@ -9,18 +9,31 @@ type Error struct {
 	Err     error
 	Conn    net.Conn
 	Request *Request
+	// Version is the negotiated SOCKS version (4 or 5), so operators can
+	// tell mixed legacy and modern traffic apart when debugging.
+	Version uint8
 }
 
 func wrapError(err error, conn net.Conn, req *Request) *Error {
+	version := socks5Version
+	if req != nil {
+		version = req.Version
+	}
+	return wrapVersionError(err, conn, req, version)
+}
+
+func wrapVersionError(err error, conn net.Conn, req *Request, version uint8) *Error {
 	return &Error{
 		Err:     err,
 		Conn:    conn,
 		Request: req,
+		Version: version,
 	}
 }
 
 func (e *Error) Error() string {
-	return fmt.Sprintf("%s -> %s: %s",
+	return fmt.Sprintf("socks%d %s -> %s: %s",
+		e.Version,
 		e.Conn.RemoteAddr(),
 		e.Conn.LocalAddr(),
 		e.Err,
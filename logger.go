@@ -0,0 +1,28 @@
+package socks5
+
+// Logger is a minimal structured logging interface, satisfied by
+// *slog.Logger, so operators get request context (remote addr, command,
+// dest addr, bytes transferred, duration) that the error-only
+// ErrorHandler can't carry.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+type noopLogger struct{}
+
+func (noopLogger) Debug(string, ...any) {}
+func (noopLogger) Info(string, ...any)  {}
+func (noopLogger) Warn(string, ...any)  {}
+func (noopLogger) Error(string, ...any) {}
+
+// logger returns the configured Logger, or a no-op implementation if
+// none was set.
+func (s *Server) logger() Logger {
+	if s.config.Logger != nil {
+		return s.config.Logger
+	}
+	return noopLogger{}
+}
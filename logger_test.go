@@ -0,0 +1,93 @@
+package socks5
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries [][]any
+}
+
+func (l *recordingLogger) record(msg string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, append([]any{msg}, args...))
+}
+
+func (l *recordingLogger) Debug(msg string, args ...any) { l.record(msg, args...) }
+func (l *recordingLogger) Info(msg string, args ...any)  { l.record(msg, args...) }
+func (l *recordingLogger) Warn(msg string, args ...any)  { l.record(msg, args...) }
+func (l *recordingLogger) Error(msg string, args ...any) { l.record(msg, args...) }
+
+func (l *recordingLogger) hasField(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, args := range l.entries {
+		for i := 0; i+1 < len(args); i++ {
+			if args[i] == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TestLoggerReceivesByteCounts confirms Config.Logger is wired into the
+// SOCKS4 connection log line with the bytes_up field of the per-connection
+// byte counts its doc comment promises.
+func TestLoggerReceivesByteCounts(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen echo: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			c, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			// Echo once then close, so both relay directions see EOF
+			// and the request finishes (and gets logged) promptly.
+			go func(c net.Conn) {
+				defer c.Close()
+				buf := make([]byte, 4096)
+				if n, err := c.Read(buf); err == nil {
+					c.Write(buf[:n])
+				}
+			}(c)
+		}
+	}()
+
+	logger := &recordingLogger{}
+	srv, err := New(&Config{Rules: PermitAll(), Logger: logger})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen proxy: %v", err)
+	}
+	defer proxyListener.Close()
+	go srv.Serve(proxyListener)
+
+	echoAddr := echo.Addr().(*net.TCPAddr)
+	conn := dialSOCKS4(t, proxyListener.Addr().String(), echoAddr.IP.String(), echoAddr.Port, "")
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	conn.Read(buf)
+	conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if logger.hasField("bytes_up") {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Logger never received a bytes_up field")
+}
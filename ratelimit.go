@@ -0,0 +1,171 @@
+package socks5
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimiter caps the throughput of proxied bytes for CONNECT streams
+// and UDP associate relays. It is consulted per request so a single
+// RateLimiter can enforce both per-connection and, once authenticated,
+// per-user caps.
+type RateLimiter interface {
+	// Reader wraps r so bytes read from the client towards the
+	// destination ("up") are throttled for req.
+	Reader(req *Request, r io.Reader) io.Reader
+
+	// Writer wraps w so bytes written back to the client ("down") are
+	// throttled for req.
+	Writer(req *Request, w io.Writer) io.Writer
+}
+
+// tokenBucket is a simple token-bucket limiter: tokens (bytes) refill at
+// rate bytes/sec up to a burst of rate bytes, and WaitN blocks until n
+// tokens are available (or ctx is done). A request larger than the burst
+// is admitted once the bucket is full and leaves it in debt, which later
+// refills pay off.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket takes bps in bits/sec, matching NewTokenBucketLimiter's
+// contract, and converts to the bytes/sec the bucket actually meters.
+func newTokenBucket(bps int64) *tokenBucket {
+	rate := float64(bps) / 8
+	return &tokenBucket{
+		rate:   rate,
+		tokens: rate,
+		last:   time.Now(),
+	}
+}
+
+func (b *tokenBucket) WaitN(ctx context.Context, n int) error {
+	if b == nil || b.rate <= 0 {
+		return nil
+	}
+
+	need := float64(n)
+	if need > b.rate {
+		need = b.rate
+	}
+
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+		b.last = now
+
+		if b.tokens >= need {
+			b.tokens -= float64(n)
+			b.mu.Unlock()
+			return nil
+		}
+
+		wait := time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+type rateLimitedReader struct {
+	ctx    context.Context
+	r      io.Reader
+	bucket *tokenBucket
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.bucket.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+type rateLimitedWriter struct {
+	ctx    context.Context
+	w      io.Writer
+	bucket *tokenBucket
+}
+
+func (w *rateLimitedWriter) Write(p []byte) (int, error) {
+	if err := w.bucket.WaitN(w.ctx, len(p)); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+type tokenBucketPair struct {
+	up, down *tokenBucket
+}
+
+// TokenBucketLimiter is a RateLimiter with per-direction bits/sec caps,
+// applied per-user once authenticated. A zero rate disables throttling
+// in that direction.
+type TokenBucketLimiter struct {
+	upBps, downBps int64
+
+	mu      sync.Mutex
+	perUser map[string]*tokenBucketPair
+}
+
+// NewTokenBucketLimiter returns a TokenBucketLimiter capping upload and
+// download throughput at upBps and downBps bits/sec respectively.
+func NewTokenBucketLimiter(upBps, downBps int64) *TokenBucketLimiter {
+	return &TokenBucketLimiter{
+		upBps:   upBps,
+		downBps: downBps,
+		perUser: make(map[string]*tokenBucketPair),
+	}
+}
+
+// bucketsFor returns the bucket pair for req: per-user if authenticated
+// with a username, otherwise a fresh per-connection pair.
+func (l *TokenBucketLimiter) bucketsFor(req *Request) *tokenBucketPair {
+	username := ""
+	if req.AuthContext != nil {
+		username = req.AuthContext.Payload["Username"]
+	}
+	if username == "" {
+		return &tokenBucketPair{up: newTokenBucket(l.upBps), down: newTokenBucket(l.downBps)}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	pair, ok := l.perUser[username]
+	if !ok {
+		pair = &tokenBucketPair{up: newTokenBucket(l.upBps), down: newTokenBucket(l.downBps)}
+		l.perUser[username] = pair
+	}
+	return pair
+}
+
+func (l *TokenBucketLimiter) Reader(req *Request, r io.Reader) io.Reader {
+	if l.upBps <= 0 {
+		return r
+	}
+	return &rateLimitedReader{ctx: context.Background(), r: r, bucket: l.bucketsFor(req).up}
+}
+
+func (l *TokenBucketLimiter) Writer(req *Request, w io.Writer) io.Writer {
+	if l.downBps <= 0 {
+		return w
+	}
+	return &rateLimitedWriter{ctx: context.Background(), w: w, bucket: l.bucketsFor(req).down}
+}
@@ -0,0 +1,70 @@
+package socks5
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketBitsPerSecond(t *testing.T) {
+	// 8000 bits/sec == 1000 bytes/sec.
+	b := newTokenBucket(8000)
+	if b.rate != 1000 {
+		t.Fatalf("rate = %v, want 1000 bytes/sec", b.rate)
+	}
+
+	// Drain the initial burst, then request another full burst's worth;
+	// since the bucket caps at rate tokens, refilling it takes ~1s.
+	if err := b.WaitN(context.Background(), 1000); err != nil {
+		t.Fatalf("WaitN: %v", err)
+	}
+
+	start := time.Now()
+	if err := b.WaitN(context.Background(), 1000); err != nil {
+		t.Fatalf("WaitN: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if elapsed < 900*time.Millisecond {
+		t.Fatalf("WaitN returned too early after %v, rate limit not enforced", elapsed)
+	}
+}
+
+func TestTokenBucketLimiterReusedAcrossReads(t *testing.T) {
+	// 8000 bits/sec == 1000 bytes/sec, so draining the 1000-byte burst
+	// and reading 200 more bytes through the *same* wrapped reader must
+	// wait ~200ms. If callers instead called Reader per read, each read
+	// would see a fresh, full bucket and never block.
+	limiter := NewTokenBucketLimiter(8000, 0)
+	req := &Request{}
+	feeder := &udpDatagramReader{}
+	r := limiter.Reader(req, feeder)
+
+	feeder.data = make([]byte, 1000)
+	if _, err := io.ReadAll(r); err != nil {
+		t.Fatalf("first read: %v", err)
+	}
+
+	feeder.data = make([]byte, 200)
+	start := time.Now()
+	if _, err := io.ReadAll(r); err != nil {
+		t.Fatalf("second read: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if elapsed < 150*time.Millisecond {
+		t.Fatalf("second read returned after %v, want reused bucket to throttle it", elapsed)
+	}
+}
+
+func TestTokenBucketZeroRateDisabled(t *testing.T) {
+	b := newTokenBucket(0)
+	start := time.Now()
+	if err := b.WaitN(context.Background(), 1<<20); err != nil {
+		t.Fatalf("WaitN: %v", err)
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Fatalf("zero rate should not throttle")
+	}
+}
@@ -0,0 +1,55 @@
+package socks5
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Redispatch replays an already-parsed inbound Request against an
+// upstream SOCKS5 proxy, reusing Dialer's ClientAuthenticator and wire
+// codec, so a front-end built on ServeConn can chain a request through
+// another proxy.
+func Redispatch(ctx context.Context, proxyNetwork, proxyAddr string, req *Request, auth ...ClientAuthenticator) (net.Conn, *AddrSpec, error) {
+	if len(auth) == 0 {
+		auth = []ClientAuthenticator{NoAuthClientAuthenticator}
+	}
+
+	var netDialer net.Dialer
+	conn, err := netDialer.DialContext(ctx, proxyNetwork, proxyAddr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dial upstream proxy %s: %w", proxyAddr, err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(aLongTimeAgo)
+		case <-done:
+		}
+	}()
+
+	if err := negotiateClientAuth(conn, auth); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("negotiate upstream auth: %w", err)
+	}
+
+	bound, err := sendClientCommand(conn, req.Command, req.DestAddr)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		return nil, nil, fmt.Errorf("redispatch %s: %w", req.DestAddr, err)
+	}
+
+	return conn, bound, nil
+}
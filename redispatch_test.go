@@ -0,0 +1,66 @@
+package socks5
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestRedispatch exercises Redispatch end-to-end: a synthetic Request is
+// replayed against a local Server, which proxies it to an echo listener.
+func TestRedispatch(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen echo: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			c, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go echoConn(c)
+		}
+	}()
+
+	srv, err := New(&Config{Rules: PermitAll()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen proxy: %v", err)
+	}
+	defer proxyListener.Close()
+	go srv.Serve(proxyListener)
+
+	echoAddr := echo.Addr().(*net.TCPAddr)
+	req := &Request{
+		Command:  socks5CmdConnect,
+		DestAddr: &AddrSpec{IP: echoAddr.IP, Port: echoAddr.Port},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _, err := Redispatch(ctx, "tcp", proxyListener.Addr().String(), req)
+	if err != nil {
+		t.Fatalf("Redispatch: %v", err)
+	}
+	defer conn.Close()
+
+	want := []byte("hello through redispatch")
+	if _, err := conn.Write(want); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	got := make([]byte, len(want))
+	if _, err := conn.Read(got); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("echo = %q, want %q", got, want)
+	}
+}
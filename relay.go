@@ -0,0 +1,39 @@
+package socks5
+
+import (
+	"io"
+	"net"
+)
+
+// relay copies bytes in both directions between conn and target until
+// both directions finish, returning the first error encountered (if
+// any). If the server has a RateLimiter configured, both directions are
+// throttled through it.
+func (s *Server) relay(req *Request, conn conn, target net.Conn) error {
+	up := io.Reader(req.bufConn)
+	down := io.Writer(conn)
+	if s.config.RateLimiter != nil {
+		up = s.config.RateLimiter.Reader(req, up)
+		down = s.config.RateLimiter.Writer(req, down)
+	}
+
+	errCh := make(chan error, 2)
+	go func() {
+		n, err := io.Copy(target, up)
+		req.bytesUp.Add(n)
+		errCh <- err
+	}()
+	go func() {
+		n, err := io.Copy(down, target)
+		req.bytesDown.Add(n)
+		errCh <- err
+	}()
+
+	var relayErr error
+	for i := 0; i < 2; i++ {
+		if err := <-errCh; err != nil && relayErr == nil {
+			relayErr = err
+		}
+	}
+	return relayErr
+}
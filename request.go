@@ -0,0 +1,202 @@
+package socks5
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	successReply         = uint8(0)
+	serverFailure        = uint8(1)
+	ruleFailure          = uint8(2)
+	networkUnreachable   = uint8(3)
+	hostUnreachable      = uint8(4)
+	connectionRefused    = uint8(5)
+	commandNotSupported  = uint8(7)
+	addrTypeNotSupported = uint8(8)
+)
+
+var unrecognizedAddrType = fmt.Errorf("unrecognized address type")
+
+// conn is the subset of net.Conn used once a Request has been parsed:
+// writing replies and reporting the client's address.
+type conn interface {
+	Write([]byte) (int, error)
+	RemoteAddr() net.Addr
+}
+
+// Request represents a request received by the server, either SOCKS5
+// (parsed by NewRequest) or SOCKS4/4a (synthesized by serveSOCKS4).
+type Request struct {
+	// Version is the negotiated SOCKS version, 4 or 5.
+	Version uint8
+	// Command is the requested command: CONNECT, BIND or (SOCKS5 only)
+	// UDP ASSOCIATE.
+	Command uint8
+	// AuthContext holds the result of authentication, if any.
+	AuthContext *AuthContext
+	// RemoteAddr is the client's address.
+	RemoteAddr *AddrSpec
+	// DestAddr is the address the client asked to reach.
+	DestAddr *AddrSpec
+
+	// bufConn is the buffered client connection, positioned just after
+	// the parsed request so it can be relayed.
+	bufConn io.Reader
+
+	// bytesUp and bytesDown count bytes proxied client->target and
+	// target->client, for Logger to report once the request completes.
+	bytesUp, bytesDown atomic.Int64
+}
+
+// NewRequest creates a new Request from the SOCKS5 request wire format.
+// The version byte and auth have already been consumed from bufConn.
+func NewRequest(bufConn io.Reader) (*Request, error) {
+	header := []byte{0, 0, 0}
+	if _, err := io.ReadFull(bufConn, header); err != nil {
+		return nil, fmt.Errorf("read command: %w", err)
+	}
+	if header[0] != socks5Version {
+		return nil, fmt.Errorf("unsupported command version: %v", header[0])
+	}
+
+	dest, err := readAddrSpec(bufConn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Request{
+		Version:  socks5Version,
+		Command:  header[1],
+		DestAddr: dest,
+		bufConn:  bufConn,
+	}, nil
+}
+
+// sendReply writes a SOCKS5 reply: version, reply code, reserved byte,
+// and the bound address, sharing the address codec with the client
+// Dialer.
+func sendReply(w io.Writer, resp uint8, addr *AddrSpec) error {
+	if _, err := w.Write([]byte{socks5Version, resp, 0}); err != nil {
+		return fmt.Errorf("write reply header: %w", err)
+	}
+	return writeAddrSpec(w, addr)
+}
+
+// handleRequest dispatches req to the command-specific handler, after
+// running it through Resolver, Rewriter and Rules.
+func (s *Server) handleRequest(req *Request, conn conn) error {
+	ctx := context.Background()
+	if s.config.BaseContext != nil {
+		ctx = s.config.BaseContext(req)
+	}
+
+	if req.DestAddr.FQDN != "" {
+		resolvedCtx, ip, err := s.config.Resolver.Resolve(ctx, req.DestAddr.FQDN)
+		if err != nil {
+			sendReply(conn, hostUnreachable, nil)
+			return fmt.Errorf("resolve %s: %w", req.DestAddr.FQDN, err)
+		}
+		ctx = resolvedCtx
+		req.DestAddr.IP = ip
+	}
+
+	if s.config.Rewriter != nil {
+		ctx, req.DestAddr = s.config.Rewriter.Rewrite(ctx, req)
+	}
+
+	ctx, ok := s.config.Rules.Allow(ctx, req)
+	if !ok {
+		sendReply(conn, ruleFailure, nil)
+		return fmt.Errorf("command %d to %v blocked by rules", req.Command, req.DestAddr)
+	}
+
+	switch req.Command {
+	case socks5CmdConnect:
+		return s.handleConnect(ctx, conn, req)
+	case socks5CmdBind:
+		return s.handleBind(ctx, conn, req)
+	case socks5CmdAssociate:
+		return s.handleAssociate(ctx, conn, req)
+	default:
+		sendReply(conn, commandNotSupported, nil)
+		return fmt.Errorf("unsupported command: %v", req.Command)
+	}
+}
+
+// handleConnect implements the CONNECT command.
+func (s *Server) handleConnect(ctx context.Context, conn conn, req *Request) error {
+	dial := s.config.Dial
+	if dial == nil {
+		dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+
+	target, err := dial(ctx, "tcp", req.DestAddr.Address())
+	if err != nil {
+		sendReply(conn, dialFailureReply(err), nil)
+		return fmt.Errorf("connect to %v: %w", req.DestAddr, err)
+	}
+	defer target.Close()
+
+	local, ok := target.LocalAddr().(*net.TCPAddr)
+	if !ok {
+		sendReply(conn, serverFailure, nil)
+		return fmt.Errorf("connect to %v: unexpected local addr type", req.DestAddr)
+	}
+
+	if err := sendReply(conn, successReply, &AddrSpec{IP: local.IP, Port: local.Port}); err != nil {
+		return fmt.Errorf("send reply: %w", err)
+	}
+
+	return s.relay(req, conn, target)
+}
+
+// handleBind implements the BIND command.
+func (s *Server) handleBind(ctx context.Context, conn conn, req *Request) error {
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: s.config.BindIP})
+	if err != nil {
+		sendReply(conn, serverFailure, nil)
+		return fmt.Errorf("bind listener: %w", err)
+	}
+	s.trackListener(listener)
+	defer s.untrackListener(listener)
+	defer listener.Close()
+
+	local := listener.Addr().(*net.TCPAddr)
+	if err := sendReply(conn, successReply, &AddrSpec{IP: local.IP, Port: local.Port}); err != nil {
+		return fmt.Errorf("send reply: %w", err)
+	}
+
+	peer, err := listener.Accept()
+	if err != nil {
+		return fmt.Errorf("accept bind connection: %w", err)
+	}
+	defer peer.Close()
+
+	remote := peer.RemoteAddr().(*net.TCPAddr)
+	if err := sendReply(conn, successReply, &AddrSpec{IP: remote.IP, Port: remote.Port}); err != nil {
+		return fmt.Errorf("send reply: %w", err)
+	}
+
+	return s.relay(req, conn, peer)
+}
+
+// dialFailureReply maps a dial error to the closest SOCKS5 reply code.
+func dialFailureReply(err error) uint8 {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "refused"):
+		return connectionRefused
+	case strings.Contains(msg, "network is unreachable"):
+		return networkUnreachable
+	default:
+		return hostUnreachable
+	}
+}
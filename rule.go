@@ -0,0 +1,38 @@
+package socks5
+
+import "context"
+
+// RuleSet is used to provide custom logic around permitting various
+// commands.
+type RuleSet interface {
+	Allow(ctx context.Context, req *Request) (context.Context, bool)
+}
+
+// PermitCommand is a RuleSet that enables filtering supported commands
+type PermitCommand struct {
+	EnableConnect   bool
+	EnableBind      bool
+	EnableAssociate bool
+}
+
+func (p *PermitCommand) Allow(ctx context.Context, req *Request) (context.Context, bool) {
+	switch req.Command {
+	case socks5CmdConnect:
+		return ctx, p.EnableConnect
+	case socks5CmdBind:
+		return ctx, p.EnableBind
+	case socks5CmdAssociate:
+		return ctx, p.EnableAssociate
+	}
+	return ctx, false
+}
+
+// PermitAll returns a RuleSet that permits all command types
+func PermitAll() RuleSet {
+	return &PermitCommand{EnableConnect: true, EnableBind: true, EnableAssociate: true}
+}
+
+// PermitNone returns a RuleSet that disallows all command types
+func PermitNone() RuleSet {
+	return &PermitCommand{}
+}
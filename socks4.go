@@ -0,0 +1,228 @@
+package socks5
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+)
+
+const (
+	socks4Version = uint8(4)
+
+	socks4CmdConnect = uint8(1)
+	socks4CmdBind    = uint8(2)
+
+	socks4Granted        = uint8(0x5A)
+	socks4Rejected       = uint8(0x5B)
+	socks4IdentdMissing  = uint8(0x5C)
+	socks4IdentdMismatch = uint8(0x5D)
+)
+
+// isSOCKS4a reports whether ip is in the reserved 0.0.0.x range, which
+// SOCKS4a clients use in place of the destination IP to signal that the
+// hostname follows the user ID instead.
+func isSOCKS4a(ip net.IP) bool {
+	ip4 := ip.To4()
+	return ip4 != nil && ip4[0] == 0 && ip4[1] == 0 && ip4[2] == 0 && ip4[3] != 0
+}
+
+// maxNullTerminatedLen bounds the SOCKS4 user ID and SOCKS4a hostname
+// fields so a client that never sends a NUL can't make us buffer an
+// unbounded amount of data.
+const maxNullTerminatedLen = 256
+
+// readNullTerminated reads bytes up to and including a NUL terminator,
+// returning everything before it. A client that never sends a NUL within
+// maxNullTerminatedLen bytes gets an error instead of us buffering
+// forever.
+func readNullTerminated(r *bufio.Reader) ([]byte, error) {
+	var b []byte
+	for len(b) <= maxNullTerminatedLen {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if c == 0 {
+			return b, nil
+		}
+		b = append(b, c)
+	}
+	return nil, fmt.Errorf("socks4 field exceeds %d bytes", maxNullTerminatedLen)
+}
+
+// serveSOCKS4 handles a connection already identified as SOCKS4/4a; the
+// version byte has already been consumed from bufConn. It returns the
+// parsed Request (even on error, if parsing got that far) so the caller
+// can log its byte counts.
+func (s *Server) serveSOCKS4(conn net.Conn, bufConn *bufio.Reader) (*Request, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(bufConn, header); err != nil {
+		return nil, fmt.Errorf("read socks4 header: %w", err)
+	}
+
+	cmd := header[0]
+	port := int(header[1])<<8 | int(header[2])
+	ip := net.IPv4(header[3], header[4], header[5], header[6])
+
+	userID, err := readNullTerminated(bufConn)
+	if err != nil {
+		return nil, fmt.Errorf("read socks4 user id: %w", err)
+	}
+
+	dest := &AddrSpec{IP: ip, Port: port}
+	if isSOCKS4a(ip) {
+		host, err := readNullTerminated(bufConn)
+		if err != nil {
+			return nil, fmt.Errorf("read socks4a hostname: %w", err)
+		}
+		dest = &AddrSpec{FQDN: string(host), Port: port}
+	}
+
+	request := &Request{
+		Version:  socks4Version,
+		Command:  cmd,
+		DestAddr: dest,
+		bufConn:  bufConn,
+	}
+	if client, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		request.RemoteAddr = &AddrSpec{IP: client.IP, Port: client.Port}
+	}
+	if len(userID) > 0 {
+		request.AuthContext = &AuthContext{
+			Method:  socks4Version,
+			Payload: map[string]string{"Username": string(userID)},
+		}
+	}
+
+	switch cmd {
+	case socks4CmdConnect:
+		return request, s.handleConnect4(request, conn)
+	case socks4CmdBind:
+		return request, s.handleBind4(request, conn)
+	default:
+		sendReply4(conn, socks4Rejected, nil)
+		return request, fmt.Errorf("unsupported socks4 command: %v", cmd)
+	}
+}
+
+// handleConnect4 implements the SOCKS4/4a CONNECT command, reusing the
+// same Rules, Rewriter, Resolver and Dial hooks as the SOCKS5 path.
+func (s *Server) handleConnect4(req *Request, conn net.Conn) error {
+	ctx := context.Background()
+	if s.config.BaseContext != nil {
+		ctx = s.config.BaseContext(req)
+	}
+
+	if s.config.Rewriter != nil {
+		ctx, req.DestAddr = s.config.Rewriter.Rewrite(ctx, req)
+	}
+
+	ctx, ok := s.config.Rules.Allow(ctx, req)
+	if !ok {
+		sendReply4(conn, socks4Rejected, nil)
+		return fmt.Errorf("connect to %v blocked by rules", req.DestAddr)
+	}
+
+	if req.DestAddr.FQDN != "" {
+		resolvedCtx, resolvedIP, err := s.config.Resolver.Resolve(ctx, req.DestAddr.FQDN)
+		if err != nil {
+			sendReply4(conn, socks4Rejected, nil)
+			return fmt.Errorf("resolve %s failed: %w", req.DestAddr.FQDN, err)
+		}
+		ctx, req.DestAddr.IP = resolvedCtx, resolvedIP
+	}
+
+	dial := s.config.Dial
+	if dial == nil {
+		dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+
+	target, err := dial(ctx, "tcp", req.DestAddr.Address())
+	if err != nil {
+		sendReply4(conn, socks4Rejected, nil)
+		return fmt.Errorf("connect to %v failed: %w", req.DestAddr, err)
+	}
+	defer target.Close()
+
+	local, ok := target.LocalAddr().(*net.TCPAddr)
+	if !ok {
+		sendReply4(conn, socks4Rejected, nil)
+		return fmt.Errorf("connect to %v failed: unexpected local addr type", req.DestAddr)
+	}
+
+	if err := sendReply4(conn, socks4Granted, &AddrSpec{IP: local.IP, Port: local.Port}); err != nil {
+		return fmt.Errorf("send socks4 reply: %w", err)
+	}
+
+	return s.relay(req, conn, target)
+}
+
+// handleBind4 implements the SOCKS4/4a BIND command.
+func (s *Server) handleBind4(req *Request, conn net.Conn) error {
+	ctx := context.Background()
+	if s.config.BaseContext != nil {
+		ctx = s.config.BaseContext(req)
+	}
+
+	if _, ok := s.config.Rules.Allow(ctx, req); !ok {
+		sendReply4(conn, socks4Rejected, nil)
+		return fmt.Errorf("bind to %v blocked by rules", req.DestAddr)
+	}
+
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: s.config.BindIP})
+	if err != nil {
+		sendReply4(conn, socks4Rejected, nil)
+		return fmt.Errorf("bind listener: %w", err)
+	}
+	s.trackListener(listener)
+	defer s.untrackListener(listener)
+	defer listener.Close()
+
+	local := listener.Addr().(*net.TCPAddr)
+	if err := sendReply4(conn, socks4Granted, &AddrSpec{IP: local.IP, Port: local.Port}); err != nil {
+		return fmt.Errorf("send socks4 reply: %w", err)
+	}
+
+	peer, err := listener.Accept()
+	if err != nil {
+		return fmt.Errorf("accept bind connection: %w", err)
+	}
+	defer peer.Close()
+
+	remote := peer.RemoteAddr().(*net.TCPAddr)
+	if err := sendReply4(conn, socks4Granted, &AddrSpec{IP: remote.IP, Port: remote.Port}); err != nil {
+		return fmt.Errorf("send socks4 reply: %w", err)
+	}
+
+	return s.relay(req, conn, peer)
+}
+
+// sendReply4 writes a SOCKS4 reply: a null version byte, the result
+// code, and the bound address.
+func sendReply4(w io.Writer, code uint8, addr *AddrSpec) error {
+	msg := make([]byte, 8)
+	msg[1] = code
+
+	var port int
+	var ip net.IP
+	if addr != nil {
+		port = addr.Port
+		ip = addr.IP
+	}
+	msg[2] = byte(port >> 8)
+	msg[3] = byte(port)
+
+	ip4 := ip.To4()
+	if ip4 == nil {
+		ip4 = net.IPv4zero.To4()
+	}
+	copy(msg[4:8], ip4)
+
+	_, err := w.Write(msg)
+	return err
+}
@@ -0,0 +1,150 @@
+package socks5
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadNullTerminatedBound(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader(strings.Repeat("a", maxNullTerminatedLen+1) + "\x00"))
+	if _, err := readNullTerminated(r); err == nil {
+		t.Fatal("expected error for field exceeding maxNullTerminatedLen")
+	}
+
+	r = bufio.NewReader(strings.NewReader("user\x00rest"))
+	got, err := readNullTerminated(r)
+	if err != nil {
+		t.Fatalf("readNullTerminated: %v", err)
+	}
+	if string(got) != "user" {
+		t.Fatalf("readNullTerminated = %q, want %q", got, "user")
+	}
+}
+
+// dialSOCKS4 dials the proxy and issues a SOCKS4/4a CONNECT, returning
+// the established connection once the server grants it.
+func dialSOCKS4(t *testing.T, proxyAddr, destIP string, destPort int, fqdn string) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", proxyAddr)
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req := []byte{4, socks4CmdConnect, byte(destPort >> 8), byte(destPort)}
+	if fqdn != "" {
+		req = append(req, 0, 0, 0, 1) // SOCKS4a: 0.0.0.x destination IP
+	} else {
+		req = append(req, net.ParseIP(destIP).To4()...)
+	}
+	req = append(req, 0) // empty user ID, NUL-terminated
+	if fqdn != "" {
+		req = append(req, fqdn...)
+		req = append(req, 0)
+	}
+
+	if _, err := conn.Write(req); err != nil {
+		t.Fatalf("write socks4 request: %v", err)
+	}
+
+	reply := make([]byte, 8)
+	if _, err := conn.Read(reply); err != nil {
+		t.Fatalf("read socks4 reply: %v", err)
+	}
+	if reply[1] != socks4Granted {
+		t.Fatalf("socks4 reply code = %#x, want %#x", reply[1], socks4Granted)
+	}
+	return conn
+}
+
+func TestSOCKS4ConnectRoundTrip(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen echo: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			c, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go echoConn(c)
+		}
+	}()
+
+	srv, err := New(&Config{Rules: PermitAll()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen proxy: %v", err)
+	}
+	defer proxyListener.Close()
+	go srv.Serve(proxyListener)
+
+	echoAddr := echo.Addr().(*net.TCPAddr)
+	conn := dialSOCKS4(t, proxyListener.Addr().String(), echoAddr.IP.String(), echoAddr.Port, "")
+	defer conn.Close()
+
+	want := []byte("hello over socks4")
+	if _, err := conn.Write(want); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	got := make([]byte, len(want))
+	if _, err := conn.Read(got); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("echo = %q, want %q", got, want)
+	}
+}
+
+func TestSOCKS4aHostnameExtension(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen echo: %v", err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			c, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go echoConn(c)
+		}
+	}()
+
+	srv, err := New(&Config{Rules: PermitAll()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	proxyListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen proxy: %v", err)
+	}
+	defer proxyListener.Close()
+	go srv.Serve(proxyListener)
+
+	echoAddr := echo.Addr().(*net.TCPAddr)
+	conn := dialSOCKS4(t, proxyListener.Addr().String(), "", echoAddr.Port, "localhost")
+	defer conn.Close()
+
+	want := []byte("hello over socks4a")
+	if _, err := conn.Write(want); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	got := make([]byte, len(want))
+	if _, err := conn.Read(got); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("echo = %q, want %q", got, want)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"time"
 )
 
 const (
@@ -53,6 +54,22 @@ type Config struct {
 
 	// Optional function for dialing out
 	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// DisableSOCKS4 turns off support for the legacy SOCKS4/4a protocol,
+	// which is otherwise detected automatically on the same listener.
+	DisableSOCKS4 bool
+
+	// Logger, if set, receives structured operational events (accept
+	// errors, auth outcomes, request dispatch, per-connection byte
+	// counts) with fields like remote addr, auth method, command, dest
+	// addr, bytes in/out and duration. A *slog.Logger satisfies this.
+	Logger Logger
+
+	// RateLimiter, if set, throttles the bytes proxied by CONNECT
+	// streams and UDP associate relays. Use NewTokenBucketLimiter for a
+	// built-in bits/sec implementation; it limits per-connection, or
+	// per-user once AuthContext.Payload["Username"] is populated.
+	RateLimiter RateLimiter
 }
 
 // Server is reponsible for accepting connections and handling
@@ -61,9 +78,16 @@ type Server struct {
 	config      *Config
 	authMethods map[uint8]Authenticator
 
-	shutdown chan struct{}
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+	onShutdown   []func()
+
 	listener net.Listener
 	lock     sync.Mutex
+
+	wg        sync.WaitGroup
+	conns     map[net.Conn]struct{}
+	listeners map[net.Listener]struct{}
 }
 
 // New creates a new Server and potentially returns an error
@@ -90,7 +114,9 @@ func New(conf *Config) (*Server, error) {
 	server := &Server{
 		config: conf,
 
-		shutdown: make(chan struct{}),
+		shutdown:  make(chan struct{}),
+		conns:     make(map[net.Conn]struct{}),
+		listeners: make(map[net.Listener]struct{}),
 	}
 
 	server.authMethods = make(map[uint8]Authenticator)
@@ -125,6 +151,7 @@ func (s *Server) Serve(l net.Listener) error {
 		for {
 			conn, err := l.Accept()
 			if err != nil {
+				s.logger().Error("accept connection failed", "error", err)
 				errs <- err
 				return
 			}
@@ -135,7 +162,19 @@ func (s *Server) Serve(l net.Listener) error {
 	for {
 		select {
 		case conn := <-conns:
+			s.lock.Lock()
+			s.conns[conn] = struct{}{}
+			s.lock.Unlock()
+
+			s.wg.Add(1)
 			go func() {
+				defer s.wg.Done()
+				defer func() {
+					s.lock.Lock()
+					delete(s.conns, conn)
+					s.lock.Unlock()
+				}()
+
 				if err := s.ServeConn(conn); err != nil && s.config.ErrorHandler != nil {
 					s.config.ErrorHandler(err)
 				}
@@ -148,22 +187,80 @@ func (s *Server) Serve(l net.Listener) error {
 	}
 }
 
-// Shutdown is used to shutdown the server. It will close the listener and
-// wait for all connections to be closed.
-func (s *Server) Shutdown() {
+// trackListener registers l so Shutdown can force-close it if ctx
+// expires before it's accepted a connection, e.g. a BIND listener with no
+// peer showing up.
+func (s *Server) trackListener(l net.Listener) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.listeners[l] = struct{}{}
+}
+
+func (s *Server) untrackListener(l net.Listener) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
-	
-	close(s.shutdown)
+	delete(s.listeners, l)
+}
+
+// RegisterOnShutdown registers a function to be called when Shutdown is
+// invoked, before it waits for in-flight connections to drain. This lets
+// long-lived UDP associations start draining as soon as shutdown begins.
+func (s *Server) RegisterOnShutdown(fn func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.onShutdown = append(s.onShutdown, fn)
+}
+
+// Shutdown gracefully shuts down the server: it stops accepting new
+// connections and waits for in-flight ServeConn sessions to finish. If
+// ctx expires first, any still-tracked connections are forcibly closed
+// and Shutdown returns ctx.Err(). It is safe to call Shutdown more than
+// once.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.lock.Lock()
+	s.shutdownOnce.Do(func() {
+		close(s.shutdown)
+	})
 	if s.listener != nil {
 		s.listener.Close()
 	}
+	onShutdown := append([]func(){}, s.onShutdown...)
+	s.lock.Unlock()
+
+	for _, fn := range onShutdown {
+		fn()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.lock.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		for l := range s.listeners {
+			l.Close()
+		}
+		s.lock.Unlock()
+
+		<-done
+		return ctx.Err()
+	}
 }
 
 // ServeConn is used to serve a single connection.
 func (s *Server) ServeConn(conn net.Conn) error {
 	defer conn.Close()
 	bufConn := bufio.NewReader(conn)
+	start := time.Now()
+	remote := conn.RemoteAddr()
 
 	// Read the version byte
 	version := []byte{0}
@@ -171,6 +268,25 @@ func (s *Server) ServeConn(conn net.Conn) error {
 		return wrapError(fmt.Errorf("read version byte: %w", err), conn, nil)
 	}
 
+	// Detect legacy SOCKS4/4a clients, which share the same version byte
+	// position, and dispatch them to their own handler.
+	if version[0] == socks4Version {
+		if s.config.DisableSOCKS4 {
+			return wrapVersionError(fmt.Errorf("socks4 support is disabled"), conn, nil, socks4Version)
+		}
+		req, err := s.serveSOCKS4(conn, bufConn)
+		var bytesUp, bytesDown int64
+		if req != nil {
+			bytesUp, bytesDown = req.bytesUp.Load(), req.bytesDown.Load()
+		}
+		if err != nil {
+			s.logger().Warn("socks4 connection failed", "remote_addr", remote, "bytes_up", bytesUp, "bytes_down", bytesDown, "duration", time.Since(start), "error", err)
+			return wrapVersionError(err, conn, nil, socks4Version)
+		}
+		s.logger().Info("socks4 connection served", "remote_addr", remote, "bytes_up", bytesUp, "bytes_down", bytesDown, "duration", time.Since(start))
+		return nil
+	}
+
 	// Ensure we are compatible
 	if version[0] != socks5Version {
 		return wrapError(fmt.Errorf("unsupported socks version: %v", version), conn, nil)
@@ -179,8 +295,10 @@ func (s *Server) ServeConn(conn net.Conn) error {
 	// Authenticate the connection
 	authContext, err := s.authenticate(conn, bufConn)
 	if err != nil {
+		s.logger().Warn("authentication failed", "remote_addr", remote, "error", err)
 		return wrapError(fmt.Errorf("authenticate: %w", err), conn, nil)
 	}
+	s.logger().Debug("authenticated", "remote_addr", remote, "auth_method", authContext.Method)
 
 	request, err := NewRequest(bufConn)
 	if err != nil {
@@ -198,8 +316,11 @@ func (s *Server) ServeConn(conn net.Conn) error {
 
 	// Process the client request
 	if err := s.handleRequest(request, conn); err != nil {
+		s.logger().Warn("request failed", "remote_addr", remote, "command", request.Command, "dest_addr", request.DestAddr, "bytes_up", request.bytesUp.Load(), "bytes_down", request.bytesDown.Load(), "duration", time.Since(start), "error", err)
 		return wrapError(fmt.Errorf("handle request: %v", err), conn, request)
 	}
 
+	s.logger().Info("request served", "remote_addr", remote, "command", request.Command, "dest_addr", request.DestAddr, "bytes_up", request.bytesUp.Load(), "bytes_down", request.bytesDown.Load(), "duration", time.Since(start))
+
 	return nil
 }
@@ -0,0 +1,71 @@
+package socks5
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestShutdownForceClosesPendingBind ensures Shutdown doesn't hang forever
+// waiting on a BIND command whose listener never accepts a peer: once ctx
+// expires, the tracked listener must be force-closed so the in-flight
+// ServeConn can return.
+func TestShutdownForceClosesPendingBind(t *testing.T) {
+	srv, err := New(&Config{Rules: PermitAll(), BindIP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+
+	served := make(chan struct{})
+	go func() {
+		srv.Serve(l)
+	}()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+
+	go func() {
+		// version/method negotiation: no-auth
+		client.Write([]byte{5, 1, 0})
+		buf := make([]byte, 2)
+		client.Read(buf)
+
+		// BIND 0.0.0.0:0, whose listener never gets a peer.
+		client.Write([]byte{5, 2, 0, 1, 0, 0, 0, 0, 0, 0})
+		reply := make([]byte, 10)
+		client.Read(reply)
+
+		close(served)
+	}()
+
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server never replied to BIND request")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- srv.Shutdown(ctx) }()
+
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("Shutdown error = %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not return; pending BIND listener was not force-closed")
+	}
+}
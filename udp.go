@@ -0,0 +1,186 @@
+package socks5
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+)
+
+// handleAssociate implements the UDP ASSOCIATE command. It supports a
+// single client peer per association and unfragmented datagrams.
+func (s *Server) handleAssociate(ctx context.Context, conn conn, req *Request) error {
+	// The UDP socket itself doesn't need listener tracking: it's torn
+	// down when the TCP control connection closes below, and that
+	// connection is already tracked in s.conns for Shutdown.
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: s.config.BindIP})
+	if err != nil {
+		sendReply(conn, serverFailure, nil)
+		return fmt.Errorf("udp associate listen: %w", err)
+	}
+	defer udpConn.Close()
+
+	local := udpConn.LocalAddr().(*net.UDPAddr)
+	if err := sendReply(conn, successReply, &AddrSpec{IP: local.IP, Port: local.Port}); err != nil {
+		return fmt.Errorf("send reply: %w", err)
+	}
+
+	upstream, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return fmt.Errorf("udp associate upstream socket: %w", err)
+	}
+	defer upstream.Close()
+
+	relayErrCh := make(chan error, 1)
+	go func() {
+		relayErrCh <- s.relayUDP(req, udpConn, upstream)
+	}()
+
+	// The TCP control connection must stay open for the lifetime of the
+	// association; reading from it detects the client (or Shutdown)
+	// closing it, which ends the association.
+	ctrlBuf := make([]byte, 1)
+	req.bufConn.Read(ctrlBuf)
+
+	udpConn.Close()
+	upstream.Close()
+	<-relayErrCh
+
+	return nil
+}
+
+// udpDatagramReader feeds a single datagram's bytes through an io.Reader
+// so a RateLimiter's wrapped reader (built once, below) can be reused
+// across a whole association instead of getting a fresh bucket per
+// datagram.
+type udpDatagramReader struct {
+	data []byte
+}
+
+func (r *udpDatagramReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// udpReplyWriter wraps a single reply datagram in the SOCKS5 UDP reply
+// header and sends it to the client's peer; from is set before each
+// Write. Like udpDatagramReader, this lets a RateLimiter's wrapped
+// writer be built once and reused across an association.
+type udpReplyWriter struct {
+	client     *net.UDPConn
+	clientAddr *net.UDPAddr
+	from       *net.UDPAddr
+}
+
+func (w *udpReplyWriter) Write(p []byte) (int, error) {
+	var out bytes.Buffer
+	out.Write([]byte{0, 0, 0})
+	if err := writeAddrSpec(&out, &AddrSpec{IP: w.from.IP, Port: w.from.Port}); err != nil {
+		return 0, err
+	}
+	out.Write(p)
+
+	if _, err := w.client.WriteToUDP(out.Bytes(), w.clientAddr); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// relayUDP forwards datagrams from the client's UDP peer to their
+// requested destinations, and spawns relayUDPReplies to forward replies
+// back once the client's peer address is known.
+func (s *Server) relayUDP(req *Request, client, upstream *net.UDPConn) error {
+	buf := make([]byte, 65507)
+
+	n, clientAddr, err := client.ReadFromUDP(buf)
+	if err != nil {
+		return nil
+	}
+
+	repliesErrCh := make(chan error, 1)
+	go func() {
+		repliesErrCh <- s.relayUDPReplies(req, client, upstream, clientAddr)
+	}()
+
+	feeder := &udpDatagramReader{}
+	var upReader io.Reader = feeder
+	if s.config.RateLimiter != nil {
+		upReader = s.config.RateLimiter.Reader(req, feeder)
+	}
+
+	s.forwardUDPDatagram(req, upstream, buf[:n], feeder, upReader)
+	for {
+		var from *net.UDPAddr
+		n, from, err = client.ReadFromUDP(buf)
+		if err != nil {
+			upstream.Close()
+			<-repliesErrCh
+			return nil
+		}
+		if from.String() != clientAddr.String() {
+			continue
+		}
+		s.forwardUDPDatagram(req, upstream, buf[:n], feeder, upReader)
+	}
+}
+
+// forwardUDPDatagram unwraps the SOCKS5 UDP request header (RSV, FRAG,
+// DST.ADDR, DST.PORT, DATA) and forwards DATA to the destination.
+// Fragmented datagrams aren't supported and are dropped. upReader wraps
+// feeder with the association's RateLimiter, if any, built once by the
+// caller and reused across datagrams so throttling accumulates properly.
+func (s *Server) forwardUDPDatagram(req *Request, upstream *net.UDPConn, packet []byte, feeder *udpDatagramReader, upReader io.Reader) {
+	if len(packet) < 4 || packet[2] != 0 {
+		return
+	}
+
+	br := bytes.NewReader(packet[3:])
+	dest, err := readAddrSpec(br)
+	if err != nil {
+		return
+	}
+	payload, err := io.ReadAll(br)
+	if err != nil {
+		return
+	}
+
+	feeder.data = payload
+	data, err := io.ReadAll(upReader)
+	if err != nil {
+		return
+	}
+
+	req.bytesUp.Add(int64(len(data)))
+	upstream.WriteToUDP(data, &net.UDPAddr{IP: dest.IP, Port: dest.Port})
+}
+
+// relayUDPReplies wraps datagrams read from upstream back into the
+// SOCKS5 UDP reply header and forwards them to the client's peer,
+// through a RateLimiter-wrapped writer built once for the lifetime of
+// the association so throttling accumulates across replies.
+func (s *Server) relayUDPReplies(req *Request, client, upstream *net.UDPConn, clientAddr *net.UDPAddr) error {
+	replyWriter := &udpReplyWriter{client: client, clientAddr: clientAddr}
+	var downWriter io.Writer = replyWriter
+	if s.config.RateLimiter != nil {
+		downWriter = s.config.RateLimiter.Writer(req, replyWriter)
+	}
+
+	buf := make([]byte, 65507)
+	for {
+		n, from, err := upstream.ReadFromUDP(buf)
+		if err != nil {
+			return nil
+		}
+
+		replyWriter.from = from
+		if _, err := downWriter.Write(buf[:n]); err != nil {
+			return err
+		}
+		req.bytesDown.Add(int64(n))
+	}
+}